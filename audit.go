@@ -0,0 +1,153 @@
+package sneaker
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path"
+	"time"
+)
+
+// AuditEvent records a single Manager operation, for compliance trails
+// that need more detail than KMS CloudTrail provides (which only sees
+// Decrypt calls, not which secret or bundle they were for).
+type AuditEvent struct {
+	Actor             string            `json:"actor"`
+	Action            string            `json:"action"`
+	Path              string            `json:"path,omitempty"`
+	KeyID             string            `json:"key_id,omitempty"`
+	EncryptionContext map[string]string `json:"encryption_context,omitempty"`
+	ETag              string            `json:"etag,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	Time              time.Time         `json:"time"`
+}
+
+// Auditor records AuditEvents. sneaker ships sinks that write to stderr, a
+// file, syslog, and S3 (see NewStderrAuditor, NewFileAuditor,
+// NewSyslogAuditor, and NewS3Auditor).
+type Auditor interface {
+	Log(event AuditEvent)
+}
+
+// audit fills in the fields common to every event and hands it to m's
+// Auditor, if one is configured. etag is the object's S3 ETag, if the
+// operation produced one (only Upload does); callers with nothing to
+// report pass "".
+func (m *Manager) audit(action, path, etag string, err error) {
+	if m.Auditor == nil {
+		return
+	}
+
+	event := AuditEvent{
+		Actor:             m.Actor,
+		Action:            action,
+		Path:              path,
+		KeyID:             m.KeyID,
+		EncryptionContext: m.EncryptionContext,
+		ETag:              etag,
+		Time:              nowFunc(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	m.Auditor.Log(event)
+}
+
+// jsonLinesAuditor writes one JSON-encoded AuditEvent per line to w.
+type jsonLinesAuditor struct {
+	w io.Writer
+}
+
+// NewStderrAuditor returns an Auditor that writes JSON lines to stderr.
+func NewStderrAuditor() Auditor {
+	return &jsonLinesAuditor{w: os.Stderr}
+}
+
+// NewFileAuditor returns an Auditor that appends JSON lines to the file at
+// path, creating it if necessary.
+func NewFileAuditor(path string) (Auditor, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesAuditor{w: f}, nil
+}
+
+func (a *jsonLinesAuditor) Log(event AuditEvent) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sneaker: unable to marshal audit event: %s\n", err)
+		return
+	}
+	fmt.Fprintln(a.w, string(b))
+}
+
+// syslogAuditor writes JSON-encoded AuditEvents to syslog.
+type syslogAuditor struct {
+	w *syslog.Writer
+}
+
+// NewSyslogAuditor returns an Auditor that writes JSON events to the local
+// syslog daemon under the "sneaker" tag.
+func NewSyslogAuditor() (Auditor, error) {
+	w, err := syslog.New(syslog.LOG_INFO, "sneaker")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogAuditor{w: w}, nil
+}
+
+func (a *syslogAuditor) Log(event AuditEvent) {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_ = a.w.Info(string(b))
+}
+
+// s3Auditor appends signed JSON records to an audit bucket, via an
+// ObjectStore, so that a tampered record can be detected even by a reader
+// without write access to the bucket.
+type s3Auditor struct {
+	store  ObjectStore
+	prefix string
+	macKey []byte
+}
+
+// NewS3Auditor returns an Auditor that writes one signed JSON object per
+// event to store, under prefix, using macKey to compute each record's
+// HMAC-SHA256 signature.
+func NewS3Auditor(store ObjectStore, prefix string, macKey []byte) Auditor {
+	return &s3Auditor{store: store, prefix: prefix, macKey: macKey}
+}
+
+type signedAuditRecord struct {
+	AuditEvent
+	MAC string `json:"mac"`
+}
+
+func (a *s3Auditor) Log(event AuditEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	mac := hmac.New(sha256.New, a.macKey)
+	mac.Write(body)
+
+	record := signedAuditRecord{AuditEvent: event, MAC: fmt.Sprintf("%x", mac.Sum(nil))}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	key := path.Join(a.prefix, fmt.Sprintf("%d-%s.json", event.Time.UnixNano(), event.Action))
+	if _, err := a.store.Put(key, bytes.NewReader(b)); err != nil {
+		fmt.Fprintf(os.Stderr, "sneaker: unable to write audit record: %s\n", err)
+	}
+}
@@ -0,0 +1,76 @@
+package sneaker
+
+import (
+	"strings"
+	"testing"
+)
+
+// recordingAuditor is an Auditor used only in tests: it appends every event
+// it's given so a test can assert on what Manager reported.
+type recordingAuditor struct {
+	events []AuditEvent
+}
+
+func (a *recordingAuditor) Log(event AuditEvent) {
+	a.events = append(a.events, event)
+}
+
+func TestManagerAuditRecordsUploadEvent(t *testing.T) {
+	auditor := &recordingAuditor{}
+	m := &Manager{
+		Objects: newMemObjectStore(),
+		Keys:    memKeyService{},
+		KeyID:   "test-key",
+		Actor:   "alice",
+		Auditor: auditor,
+	}
+
+	if err := m.Upload("a/b", strings.NewReader("hunter2")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	if len(auditor.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(auditor.events))
+	}
+
+	event := auditor.events[0]
+	if event.Actor != "alice" {
+		t.Errorf("Actor = %q, want alice", event.Actor)
+	}
+	if event.Action != "upload" {
+		t.Errorf("Action = %q, want upload", event.Action)
+	}
+	if event.Path != "a/b" {
+		t.Errorf("Path = %q, want a/b", event.Path)
+	}
+	if event.KeyID != "test-key" {
+		t.Errorf("KeyID = %q, want test-key", event.KeyID)
+	}
+	if event.Error != "" {
+		t.Errorf("Error = %q, want empty", event.Error)
+	}
+}
+
+// TestManagerAuditRecordsErrors confirms a failed operation's error message
+// ends up on its AuditEvent, so a compliance trail still records the
+// attempt even when it didn't succeed.
+func TestManagerAuditRecordsErrors(t *testing.T) {
+	auditor := &recordingAuditor{}
+	m := &Manager{
+		Objects: newMemObjectStore(),
+		Keys:    memKeyService{},
+		KeyID:   "test-key",
+		Auditor: auditor,
+	}
+
+	if _, err := m.Download([]string{"missing"}); err == nil {
+		t.Fatal("expected Download of a missing path to fail")
+	}
+
+	if len(auditor.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(auditor.events))
+	}
+	if auditor.events[0].Error == "" {
+		t.Error("expected Error to be populated on a failed operation")
+	}
+}
@@ -0,0 +1,118 @@
+package sneaker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecodeBech32 decodes a bech32-encoded string (BIP-0173) into its human
+// readable part and raw data bytes. age public keys ("age1...") and
+// identities ("AGE-SECRET-KEY-1...") are both bech32, so this is shared by
+// recipients.go (to parse an identity file) and cmd/sneaker (to parse a
+// --recipient flag).
+func DecodeBech32(s string) (hrp string, data []byte, err error) {
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return "", nil, fmt.Errorf("sneaker: mixed-case bech32 string")
+	}
+	lower := strings.ToLower(s)
+
+	sep := strings.LastIndexByte(lower, '1')
+	if sep < 1 || sep+7 > len(lower) {
+		return "", nil, fmt.Errorf("sneaker: malformed bech32 string")
+	}
+
+	hrp = lower[:sep]
+	values := make([]byte, len(lower)-sep-1)
+	for i, c := range lower[sep+1:] {
+		if c > 127 || bech32CharsetRev[c] == -1 {
+			return "", nil, fmt.Errorf("sneaker: invalid bech32 character %q", c)
+		}
+		values[i] = byte(bech32CharsetRev[c])
+	}
+
+	if !bech32VerifyChecksum(hrp, values) {
+		return "", nil, fmt.Errorf("sneaker: invalid bech32 checksum")
+	}
+
+	data, err = bech32ConvertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32CharsetRev = func() [128]int8 {
+	var rev [128]int8
+	for i := range rev {
+		rev[i] = -1
+	}
+	for i, c := range bech32Charset {
+		rev[c] = int8(i)
+	}
+	return rev
+}()
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := byte(chk >> 25)
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		out = append(out, byte(c)>>5)
+	}
+	out = append(out, 0)
+	for _, c := range hrp {
+		out = append(out, byte(c)&31)
+	}
+	return out
+}
+
+func bech32VerifyChecksum(hrp string, values []byte) bool {
+	return bech32Polymod(append(bech32HRPExpand(hrp), values...)) == 1
+}
+
+// bech32ConvertBits regroups data from fromBits-wide groups into
+// toBits-wide groups, the way bech32 packs 8-bit bytes into 5-bit words
+// (and back).
+func bech32ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+
+	var out []byte
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, fmt.Errorf("sneaker: invalid bech32 data")
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits)&byte(maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits))&byte(maxv))
+		}
+	} else if bits >= fromBits || (byte(acc<<(toBits-bits))&byte(maxv)) != 0 {
+		return nil, fmt.Errorf("sneaker: invalid bech32 padding")
+	}
+
+	return out, nil
+}
@@ -5,9 +5,11 @@ package main
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
+	"os/exec"
 	"strings"
 	"text/tabwriter"
 
@@ -15,7 +17,8 @@ import (
 	"github.com/awslabs/aws-sdk-go/gen/kms"
 	"github.com/awslabs/aws-sdk-go/gen/s3"
 	"github.com/docopt/docopt-go"
-	"github.com/stripe/sneaker"
+	"github.com/dstnbrkr/sneaker"
+	vaultapi "github.com/hashicorp/vault/api"
 )
 
 const usage = `sneaker manages secrets.
@@ -24,22 +27,43 @@ Usage:
   sneaker ls [<pattern>]
   sneaker upload <file> <path>
   sneaker rm <path>
-  sneaker pack <pattern> <file> [--context=<k1=v2,k2=v2>]
-  sneaker unpack <file> <path> [--context=<k1=v2,k2=v2>]
+  sneaker pack <pattern> <file> [--context=<k1=v2,k2=v2>] [--format=<format>] [--recipient=<recipient>]...
+  sneaker unpack <file> <path> [--context=<k1=v2,k2=v2>] [--format=<format>] [--secret=<secret>]
   sneaker rotate [<pattern>]
+  sneaker edit <path>
+  sneaker diff <path> <localfile>
   sneaker version
 
 Options:
-  -h --help  Show this help information.
+  -h --help                Show this help information.
+  --format=<format>        The pack/unpack format: "tar" (default), "sops", or "stream" [default: tar].
+  --recipient=<recipient>  An age ("age1...") or PGP ("pgp:<fingerprint>") recipient that
+                           can unpack the bundle offline, in addition to KMS.
+  --secret=<secret>        The path of the secret to extract from a sops/stream bundle, if
+                           it differs from <path> (which otherwise names both the secret
+                           to extract and the local destination to write it to).
+
+<file> and <path> may be local paths, "-" for stdin/stdout, or URIs
+understood by a registered filesystem: s3://bucket/key, gs://bucket/object,
+vault://mount/path, and file:///absolute/path.
 
 Environment Variables:
-  SNEAKER_REGION        The AWS region where the key and bucket are located.
-  SNEAKER_KEY_ID        The KMS key to use when encrypting secrets.
-  SNEAKER_S3_PATH       Where secrets will be stored (e.g. s3://bucket/path).
-  SNEAKER_ENC_CONTEXT   The KMS encryption context to use for stored secrets.
+  SNEAKER_BACKEND            The storage backend to use: "s3" (default) or "vault".
+  SNEAKER_REGION             The AWS region where the key and bucket are located.
+  SNEAKER_KEY_ID             The KMS key to use when encrypting secrets.
+  SNEAKER_S3_PATH            Where secrets will be stored (e.g. s3://bucket/path).
+  SNEAKER_ENC_CONTEXT        The encryption context to use for stored secrets.
+  VAULT_ADDR                 The address of the Vault server (backend=vault).
+  VAULT_TOKEN                The token to authenticate to Vault with (backend=vault).
+  SNEAKER_VAULT_MOUNT        The mount point of the KV v2 engine secrets live in.
+  SNEAKER_VAULT_TRANSIT_KEY  The Transit engine key used to encrypt secrets.
+  SNEAKER_AUDIT              Where to send an audit trail of every command:
+                             stderr, file:<path>, syslog, or s3://bucket/prefix.
 `
 
 func main() {
+	registerFilesystems()
+
 	args, err := docopt.Parse(usage, nil, true, version, false)
 	if err != nil {
 		log.Fatal(err)
@@ -88,10 +112,7 @@ func main() {
 
 		log.Printf("uploading %s", file)
 
-		f, err := os.Open(file)
-		if err != nil {
-			log.Fatal(err)
-		}
+		f := openPath(file, false)
 		defer f.Close()
 
 		if err := manager.Upload(path, f); err != nil {
@@ -117,6 +138,10 @@ func main() {
 			context = c
 		}
 
+		if flags, ok := args["--recipient"].([]string); ok {
+			manager.Recipients = parseRecipients(flags)
+		}
+
 		// list files
 		files, err := manager.List(pattern)
 		if err != nil {
@@ -130,18 +155,35 @@ func main() {
 
 		log.Printf("packing %v", paths)
 
-		// download secrets
-		secrets, err := manager.Download(paths)
+		// write to file or STDOUT
+		out := openPath(file, true)
+
+		// pack secrets
+		switch packFormat(args) {
+		case "stream":
+			err = manager.PackStream(paths, context, out)
+		case "sops":
+			secrets, derr := manager.Download(paths)
+			if derr != nil {
+				log.Fatal(derr)
+			}
+			err = manager.PackSOPS(secrets, context, out)
+		default:
+			secrets, derr := manager.Download(paths)
+			if derr != nil {
+				log.Fatal(derr)
+			}
+			err = manager.Pack(secrets, context, out)
+		}
 		if err != nil {
+			out.Close()
 			log.Fatal(err)
 		}
 
-		// write to file or STDOUT
-		out := openPath(file, os.Create, os.Stdout)
-		defer out.Close()
-
-		// pack secrets
-		if err := manager.Pack(secrets, context, out); err != nil {
+		// out.Close() is what actually performs the upload for remote
+		// destinations (s3://, gs://, vault://), so its error has to be
+		// checked explicitly rather than left to a deferred call.
+		if err := out.Close(); err != nil {
 			log.Fatal(err)
 		}
 	} else if args["unpack"] == true {
@@ -156,20 +198,61 @@ func main() {
 			context = c
 		}
 
+		// secret defaults to path, since <path> conventionally names both
+		// the secret to extract from a sops/stream bundle and the local
+		// destination to write it to; --secret lets the two differ.
+		secret := path
+		if s, ok := args["--secret"].(string); ok && s != "" {
+			secret = s
+		}
+
 		// read from file or STDIN
-		in := openPath(file, os.Open, os.Stdin)
+		in := openPath(file, false)
 		defer in.Close()
 
 		// write to file or STDOUT
-		out := openPath(path, os.Create, os.Stdout)
-		defer out.Close()
+		out := openPath(path, true)
 
-		r, err := manager.Unpack(context, in)
-		if err != nil {
-			log.Fatal(err)
+		switch packFormat(args) {
+		case "sops":
+			secrets, err := manager.UnpackSOPS(context, in, secret)
+			if err != nil {
+				log.Fatal(err)
+			}
+			plaintext, ok := secrets[secret]
+			if !ok {
+				out.Close()
+				log.Fatalf("sneaker: %s not found in bundle", secret)
+			}
+			if _, err := out.Write(plaintext); err != nil {
+				out.Close()
+				log.Fatal(err)
+			}
+		case "stream":
+			sr, err := manager.UnpackStream(context, in)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer sr.Close()
+			if err := writeStreamedSecret(sr, secret, out); err != nil {
+				out.Close()
+				log.Fatal(err)
+			}
+		default:
+			r, err := manager.Unpack(context, in)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := io.Copy(out, r); err != nil {
+				out.Close()
+				log.Fatal(err)
+			}
 		}
 
-		if _, err := io.Copy(out, r); err != nil {
+		// out.Close() is what actually performs the upload for remote
+		// destinations (s3://, gs://, vault://), so its error has to be
+		// checked explicitly rather than left to a deferred call.
+		if err := out.Close(); err != nil {
 			log.Fatal(err)
 		}
 	} else if args["rotate"] == true {
@@ -183,37 +266,210 @@ func main() {
 		}); err != nil {
 			log.Fatal(err)
 		}
+	} else if args["edit"] == true {
+		path := args["<path>"].(string)
+
+		if err := manager.Edit(path, editInEditor); err != nil {
+			log.Fatal(err)
+		}
+	} else if args["diff"] == true {
+		path := args["<path>"].(string)
+		localfile := args["<localfile>"].(string)
+
+		local, err := ioutil.ReadFile(localfile)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		d, err := manager.Diff(path, local)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(d)
 	} else {
 		fmt.Fprintf(os.Stderr, "Unknown command: %v\n", os.Args)
 	}
 }
 
 func loadManager() *sneaker.Manager {
-	region := os.Getenv("SNEAKER_REGION")
-	if region == "" {
-		log.Fatal("missing SNEAKER_REGION")
+	ctxt, err := parseContext(os.Getenv("SNEAKER_ENC_CONTEXT"))
+	if err != nil {
+		log.Fatalf("bad SNEAKER_ENC_CONTEXT: %s", err)
 	}
 
-	u, err := url.Parse(os.Getenv("SNEAKER_S3_PATH"))
-	if err != nil {
-		log.Fatalf("bad SNEAKER_S3_PATH: %s", err)
+	backend := os.Getenv("SNEAKER_BACKEND")
+	if backend == "" {
+		backend = "s3"
 	}
 
-	creds := aws.DetectCreds("", "", "")
+	var objects sneaker.ObjectStore
+	var keys sneaker.KeyService
+	var keyID string
 
-	ctxt, err := parseContext(os.Getenv("SNEAKER_ENC_CONTEXT"))
+	switch backend {
+	case "s3":
+		region := os.Getenv("SNEAKER_REGION")
+		if region == "" {
+			log.Fatal("missing SNEAKER_REGION")
+		}
+
+		u, err := url.Parse(os.Getenv("SNEAKER_S3_PATH"))
+		if err != nil {
+			log.Fatalf("bad SNEAKER_S3_PATH: %s", err)
+		}
+
+		creds := aws.DetectCreds("", "", "")
+
+		objects = sneaker.NewS3Store(s3.New(creds, region, nil), u.Host, u.Path)
+		keys = sneaker.NewKMSKeyService(kms.New(creds, region, nil))
+		keyID = os.Getenv("SNEAKER_KEY_ID")
+	case "vault":
+		store := loadVaultStore()
+		objects = store
+		keys = store
+	default:
+		log.Fatalf("unknown SNEAKER_BACKEND: %s", backend)
+	}
+
+	auditor, err := loadAuditor(os.Getenv("SNEAKER_AUDIT"))
 	if err != nil {
-		log.Fatalf("bad SNEAKER_ENC_CONTEXT: %s", err)
+		log.Fatalf("bad SNEAKER_AUDIT: %s", err)
 	}
 
 	return &sneaker.Manager{
-		Objects:           s3.New(creds, region, nil),
-		Keys:              kms.New(creds, region, nil),
-		KeyID:             os.Getenv("SNEAKER_KEY_ID"),
-		Bucket:            u.Host,
-		Prefix:            u.Path,
+		Objects:           objects,
+		Keys:              keys,
+		KeyID:             keyID,
 		EncryptionContext: ctxt,
+		Auditor:           auditor,
+		Actor:             currentActor(),
+	}
+}
+
+// loadAuditor builds the Auditor named by spec: "stderr", "file:<path>",
+// "syslog", "s3://bucket/prefix", or "" for no auditing.
+func loadAuditor(spec string) (sneaker.Auditor, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "stderr":
+		return sneaker.NewStderrAuditor(), nil
+	case spec == "syslog":
+		return sneaker.NewSyslogAuditor()
+	case strings.HasPrefix(spec, "file:"):
+		return sneaker.NewFileAuditor(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "s3://"):
+		u, err := url.Parse(spec)
+		if err != nil {
+			return nil, err
+		}
+		region := os.Getenv("SNEAKER_REGION")
+		client := s3.New(aws.DetectCreds("", "", ""), region, nil)
+		macKey := []byte(os.Getenv("SNEAKER_AUDIT_MAC_KEY"))
+		return sneaker.NewS3Auditor(sneaker.NewS3Store(client, u.Host, u.Path), "", macKey), nil
+	default:
+		return nil, fmt.Errorf("unrecognized SNEAKER_AUDIT: %s", spec)
+	}
+}
+
+// currentActor identifies the user running this command, for audit events.
+func currentActor() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return "unknown"
+}
+
+// loadVaultStore builds the VaultStore for the "vault" backend, mounted at
+// SNEAKER_VAULT_MOUNT.
+func loadVaultStore() *sneaker.VaultStore {
+	mount := os.Getenv("SNEAKER_VAULT_MOUNT")
+	if mount == "" {
+		log.Fatal("missing SNEAKER_VAULT_MOUNT")
 	}
+	return newVaultStore(mount)
+}
+
+// newVaultStore builds a VaultStore mounted at mount, using
+// SNEAKER_VAULT_TRANSIT_KEY, VAULT_ADDR, and VAULT_TOKEN for the rest of
+// its configuration. mount comes from SNEAKER_VAULT_MOUNT for the "vault"
+// backend, or from a vault:// URI's own mount component for openVault.
+//
+// SNEAKER_VAULT_TRANSIT_KEY is only required when the store is actually
+// asked to generate or unwrap a data key (e.g. as the "vault" KeyService
+// backend): a vault:// destination used purely as a pack/unpack
+// ObjectStore never calls GenerateDataKey/Decrypt, so it shouldn't need
+// a transit key configured. VaultStore itself enforces that lazily.
+func newVaultStore(mount string) *sneaker.VaultStore {
+	client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	if err != nil {
+		log.Fatalf("unable to create vault client: %s", err)
+	}
+	client.SetToken(os.Getenv("VAULT_TOKEN"))
+
+	return sneaker.NewVaultStore(client, mount, os.Getenv("SNEAKER_VAULT_TRANSIT_KEY"))
+}
+
+// editInEditor writes plaintext to a tempfile, opens it in $EDITOR, and
+// returns the tempfile's contents once the editor exits. The tempfile is
+// removed before editInEditor returns.
+func editInEditor(plaintext []byte) ([]byte, error) {
+	f, err := ioutil.TempFile("", "sneaker-edit-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %s", editor, err)
+	}
+
+	return ioutil.ReadFile(f.Name())
+}
+
+// writeStreamedSecret copies path's plaintext from sr to out. By the time
+// UnpackStream returns sr, every file's chunks and the bundle's trailing
+// HMAC have already been verified, so this only has to find the right
+// file, not defend against a still-unverified one.
+func writeStreamedSecret(sr *sneaker.StreamReader, path string, out io.Writer) error {
+	for {
+		p, err := sr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("sneaker: %s not found in bundle", path)
+		}
+		if err != nil {
+			return err
+		}
+		if p == path {
+			_, err := io.Copy(out, sr)
+			return err
+		}
+	}
+}
+
+// packFormat returns the --format flag's value, defaulting to "tar".
+func packFormat(args map[string]interface{}) string {
+	if s, ok := args["--format"].(string); ok && s != "" {
+		return s
+	}
+	return "tar"
 }
 
 func parseContext(s string) (map[string]string, error) {
@@ -232,17 +488,48 @@ func parseContext(s string) (map[string]string, error) {
 	return context, nil
 }
 
-func openPath(file string, o func(string) (*os.File, error), def *os.File) *os.File {
+// openPath opens file for reading or writing. "-" means stdin/stdout, a URI
+// with a registered scheme (s3://, gs://, vault://, file://) is dispatched
+// through sneaker.OpenFS, and anything else is treated as a local path.
+func openPath(file string, write bool) io.ReadWriteCloser {
 	if file == "-" {
-		return def
+		if write {
+			return stdioHandle{os.Stdout}
+		}
+		return stdioHandle{os.Stdin}
 	}
-	f, err := o(file)
+
+	if sneaker.HasScheme(file) {
+		f, err := sneaker.OpenFS(file, write)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f
+	}
+
+	if write {
+		f, err := os.Create(file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return f
+	}
+
+	f, err := os.Open(file)
 	if err != nil {
 		log.Fatal(err)
 	}
 	return f
 }
 
+// stdioHandle adapts stdin/stdout, which sneaker never closes, to
+// io.ReadWriteCloser.
+type stdioHandle struct {
+	*os.File
+}
+
+func (stdioHandle) Close() error { return nil }
+
 var (
 	version   = "unknown" // version of sneaker
 	goVersion = "unknown" // version of go we build with
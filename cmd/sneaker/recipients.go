@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/dstnbrkr/sneaker"
+)
+
+const (
+	agePublicKeyPrefix = "age1"
+	agePublicKeyHRP    = "age"
+)
+
+// parseRecipients turns a list of --recipient flags (age1... or
+// pgp:<fingerprint>) into sneaker.Recipients.
+func parseRecipients(flags []string) []sneaker.Recipient {
+	recipients := make([]sneaker.Recipient, 0, len(flags))
+	for _, flag := range flags {
+		switch {
+		case strings.HasPrefix(flag, agePublicKeyPrefix):
+			r, err := parseAgeRecipient(flag)
+			if err != nil {
+				log.Fatalf("bad --recipient %s: %s", flag, err)
+			}
+			recipients = append(recipients, r)
+		case strings.HasPrefix(flag, "pgp:"):
+			fingerprint := strings.TrimPrefix(flag, "pgp:")
+			r, err := parsePGPRecipient(fingerprint)
+			if err != nil {
+				log.Fatalf("bad --recipient %s: %s", flag, err)
+			}
+			recipients = append(recipients, r)
+		default:
+			log.Fatalf("unrecognized --recipient: %s", flag)
+		}
+	}
+	return recipients
+}
+
+func parseAgeRecipient(id string) (sneaker.Recipient, error) {
+	hrp, decoded, err := sneaker.DecodeBech32(id)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != agePublicKeyHRP || len(decoded) != 32 {
+		return nil, fmt.Errorf("malformed age recipient")
+	}
+
+	var publicKey [32]byte
+	copy(publicKey[:], decoded)
+	return sneaker.NewAgeRecipient(id, publicKey), nil
+}
+
+func parsePGPRecipient(fingerprint string) (sneaker.Recipient, error) {
+	out, err := exec.Command("gpg", "--export", "--armor", fingerprint).Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to export public key from gpg: %s", err)
+	}
+	return sneaker.NewPGPRecipient(fingerprint, bytes.NewReader(out))
+}
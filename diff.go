@@ -0,0 +1,121 @@
+package sneaker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// unifiedDiff returns a unified diff between the lines of a and b, labeled
+// as the two sides of path. It's a small, self-contained LCS-based diff:
+// sneaker only ever diffs individual secrets, which are small enough that
+// there's no need to reach for an external diff tool or library.
+func unifiedDiff(path string, a, b []byte) string {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+
+	ops := diffLines(aLines, bLines)
+	if allEqual(ops) {
+		return ""
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- a/%s\n", path)
+	fmt.Fprintf(&out, "+++ b/%s\n", path)
+	// a single hunk covering both files in full
+	aStart, bStart := 1, 1
+	if len(aLines) == 0 {
+		aStart = 0
+	}
+	if len(bLines) == 0 {
+		bStart = 0
+	}
+	fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, len(aLines), bStart, len(bLines))
+	for _, op := range ops {
+		switch op.kind {
+		case diffEqual:
+			fmt.Fprintf(&out, " %s\n", op.line)
+		case diffDelete:
+			fmt.Fprintf(&out, "-%s\n", op.line)
+		case diffInsert:
+			fmt.Fprintf(&out, "+%s\n", op.line)
+		}
+	}
+	return out.String()
+}
+
+type diffKind int
+
+const (
+	diffEqual diffKind = iota
+	diffDelete
+	diffInsert
+)
+
+type diffOp struct {
+	kind diffKind
+	line string
+}
+
+func allEqual(ops []diffOp) bool {
+	for _, op := range ops {
+		if op.kind != diffEqual {
+			return false
+		}
+	}
+	return true
+}
+
+func splitLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// diffLines computes a longest-common-subsequence diff between a and b.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{diffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{diffDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{diffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{diffDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{diffInsert, b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,42 @@
+package sneaker
+
+import "bytes"
+
+// Edit decrypts the secret at path, passes its plaintext to edit, and
+// re-encrypts and uploads whatever edit returns under a freshly generated
+// data key. If edit returns the same plaintext unchanged, Edit skips the
+// upload entirely, so a no-op edit doesn't churn the object's ETag.
+//
+// Like Download, Edit fails if SNEAKER_ENC_CONTEXT doesn't match the
+// context the secret was uploaded with.
+func (m *Manager) Edit(path string, edit func(plaintext []byte) ([]byte, error)) (err error) {
+	defer func() { m.audit("edit", path, "", err) }()
+
+	original, err := m.download(path)
+	if err != nil {
+		return err
+	}
+
+	edited, err := edit(original)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(original, edited) {
+		return nil
+	}
+
+	return m.Upload(path, bytes.NewReader(edited))
+}
+
+// Diff decrypts the secret at path and returns a unified diff against
+// local. The secret's plaintext never touches disk.
+func (m *Manager) Diff(path string, local []byte) (diff string, err error) {
+	defer func() { m.audit("diff", path, "", err) }()
+
+	remote, err := m.download(path)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(path, remote, local), nil
+}
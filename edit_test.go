@@ -0,0 +1,89 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestManagerEditUploadsChangedPlaintext(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	err := m.Edit("a", func(plaintext []byte) ([]byte, error) {
+		return []byte(strings.ToUpper(string(plaintext))), nil
+	})
+	if err != nil {
+		t.Fatalf("Edit: %s", err)
+	}
+
+	secrets, err := m.Download([]string{"a"})
+	if err != nil {
+		t.Fatalf("Download: %s", err)
+	}
+	if string(secrets["a"]) != "HELLO" {
+		t.Errorf("secrets[a] = %q, want HELLO", secrets["a"])
+	}
+}
+
+// TestManagerEditSkipsUploadWhenUnchanged confirms a no-op edit doesn't
+// churn the object store, per Edit's doc comment.
+func TestManagerEditSkipsUploadWhenUnchanged(t *testing.T) {
+	store := newMemObjectStore()
+	m := &Manager{Objects: store, Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("hello")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	before, err := store.Get("a")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	beforeBytes, err := ioutil.ReadAll(before)
+	before.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+
+	err = m.Edit("a", func(plaintext []byte) ([]byte, error) {
+		return plaintext, nil
+	})
+	if err != nil {
+		t.Fatalf("Edit: %s", err)
+	}
+
+	after, err := store.Get("a")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	afterBytes, err := ioutil.ReadAll(after)
+	after.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+
+	if string(beforeBytes) != string(afterBytes) {
+		t.Error("expected a no-op Edit to leave the stored envelope untouched")
+	}
+}
+
+func TestManagerDiff(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("line1\nline2\n")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	diff, err := m.Diff("a", []byte("line1\nchanged\n"))
+	if err != nil {
+		t.Fatalf("Diff: %s", err)
+	}
+
+	if !strings.Contains(diff, "-line2") || !strings.Contains(diff, "+changed") {
+		t.Errorf("diff = %q, want it to show line2 removed and changed added", diff)
+	}
+}
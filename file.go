@@ -0,0 +1,11 @@
+package sneaker
+
+import "time"
+
+// File describes a secret stored in an ObjectStore.
+type File struct {
+	Path         string
+	LastModified time.Time
+	Size         int64
+	ETag         string
+}
@@ -0,0 +1,49 @@
+package sneaker
+
+import (
+	"fmt"
+	"io"
+)
+
+// FSOpener opens uri for either reading or writing (as indicated by write)
+// and returns a handle for its contents.
+type FSOpener func(uri string, write bool) (io.ReadWriteCloser, error)
+
+var fsRegistry = map[string]FSOpener{}
+
+// RegisterFS registers opener as the handler for URIs of the form
+// "scheme://...". It's used to teach sneaker's CLI about well-known
+// filesystems beyond the local disk, such as s3://, gs://, and vault://.
+func RegisterFS(scheme string, opener FSOpener) {
+	fsRegistry[scheme] = opener
+}
+
+// OpenFS opens uri using the FSOpener registered for its scheme. It returns
+// an error if uri has no scheme or none is registered for it.
+func OpenFS(uri string, write bool) (io.ReadWriteCloser, error) {
+	scheme := schemeOf(uri)
+	if scheme == "" {
+		return nil, fmt.Errorf("sneaker: no scheme in %q", uri)
+	}
+
+	opener, ok := fsRegistry[scheme]
+	if !ok {
+		return nil, fmt.Errorf("sneaker: no filesystem registered for scheme %q", scheme)
+	}
+	return opener(uri, write)
+}
+
+// HasScheme reports whether uri has a registered scheme, e.g. "s3://...".
+func HasScheme(uri string) bool {
+	_, ok := fsRegistry[schemeOf(uri)]
+	return ok
+}
+
+func schemeOf(uri string) string {
+	for i := 0; i < len(uri)-2; i++ {
+		if uri[i] == ':' && uri[i+1] == '/' && uri[i+2] == '/' {
+			return uri[:i]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,40 @@
+package sneaker
+
+import (
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/kms"
+)
+
+// kmsKeyService is a KeyService backed by AWS KMS.
+type kmsKeyService struct {
+	client *kms.KMS
+}
+
+// NewKMSKeyService returns a KeyService which generates and unwraps data
+// keys using client.
+func NewKMSKeyService(client *kms.KMS) KeyService {
+	return &kmsKeyService{client: client}
+}
+
+func (k *kmsKeyService) GenerateDataKey(keyID string, context map[string]string) (plaintext, ciphertext []byte, err error) {
+	resp, err := k.client.GenerateDataKey(&kms.GenerateDataKeyRequest{
+		KeyID:             aws.String(keyID),
+		EncryptionContext: context,
+		KeySpec:           aws.String("AES_256"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Plaintext, resp.CiphertextBlob, nil
+}
+
+func (k *kmsKeyService) Decrypt(ciphertext []byte, context map[string]string) ([]byte, error) {
+	resp, err := k.client.Decrypt(&kms.DecryptRequest{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: context,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
@@ -0,0 +1,232 @@
+package sneaker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// randReader is the source of cryptographic randomness used throughout
+// sneaker. It's a var so tests can swap it out.
+var randReader = rand.Reader
+
+// Manager provides access to a set of secrets stored in an ObjectStore,
+// encrypted via a KeyService.
+type Manager struct {
+	// Objects is where the encrypted bytes of secrets live.
+	Objects ObjectStore
+
+	// Keys generates and unwraps the data keys used to encrypt secrets.
+	Keys KeyService
+
+	// KeyID identifies the master key Keys should use when generating new
+	// data keys.
+	KeyID string
+
+	// EncryptionContext is additional authenticated data bound to every
+	// data key Manager generates.
+	EncryptionContext map[string]string
+
+	// Recipients additionally wraps every Pack bundle's data key for each
+	// recipient, so Unpack can fall back to a local identity when KMS
+	// isn't reachable (e.g. unpacking on a laptop with no AWS creds).
+	Recipients []Recipient
+
+	// Auditor, if set, is sent an AuditEvent for every Manager operation.
+	Auditor Auditor
+
+	// Actor identifies who's driving this Manager, for audit events.
+	Actor string
+}
+
+// List returns the secrets whose base name (the last element of the path)
+// matches pattern, a comma-separated list of path.Match globs. An empty
+// pattern matches everything.
+func (m *Manager) List(pattern string) ([]File, error) {
+	files, err := m.Objects.List("")
+	m.audit("list", pattern, "", err)
+	if err != nil {
+		return nil, err
+	}
+
+	if pattern == "" {
+		return files, nil
+	}
+
+	globs := strings.Split(pattern, ",")
+	matched := make([]File, 0, len(files))
+	for _, f := range files {
+		for _, g := range globs {
+			if ok, _ := path.Match(g, path.Base(f.Path)); ok {
+				matched = append(matched, f)
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// Upload encrypts the contents of r under a freshly generated data key and
+// stores the result at path.
+func (m *Manager) Upload(p string, r io.Reader) (err error) {
+	var etag string
+	defer func() { m.audit("upload", p, etag, err) }()
+
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	key, wrappedKey, err := m.Keys.GenerateDataKey(m.KeyID, m.EncryptionContext)
+	if err != nil {
+		return fmt.Errorf("sneaker: unable to generate data key: %s", err)
+	}
+
+	ciphertext, err := encrypt(key, plaintext)
+	if err != nil {
+		return err
+	}
+
+	etag, err = m.Objects.Put(p, bytes.NewReader(envelope(wrappedKey, ciphertext)))
+	return err
+}
+
+// Download decrypts and returns the secrets at the given paths, keyed by
+// path.
+func (m *Manager) Download(paths []string) (map[string][]byte, error) {
+	secrets := make(map[string][]byte, len(paths))
+	for _, p := range paths {
+		b, err := m.download(p)
+		m.audit("download", p, "", err)
+		if err != nil {
+			return nil, err
+		}
+		secrets[p] = b
+	}
+	return secrets, nil
+}
+
+func (m *Manager) download(p string) ([]byte, error) {
+	r, err := m.Objects.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, ciphertext, err := unenvelope(b)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.Keys.Decrypt(wrappedKey, m.EncryptionContext)
+	if err != nil {
+		return nil, fmt.Errorf("sneaker: unable to decrypt data key for %s: %s", p, err)
+	}
+
+	return decrypt(key, ciphertext)
+}
+
+// Rm deletes the secret at path.
+func (m *Manager) Rm(p string) (err error) {
+	defer func() { m.audit("rm", p, "", err) }()
+	return m.Objects.Delete(p)
+}
+
+// Rotate re-encrypts every secret matching pattern under a freshly
+// generated data key, calling progress with each path as it's rotated.
+func (m *Manager) Rotate(pattern string, progress func(string)) (err error) {
+	defer func() { m.audit("rotate", pattern, "", err) }()
+
+	files, err := m.List(pattern)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if progress != nil {
+			progress(f.Path)
+		}
+
+		plaintext, err := m.download(f.Path)
+		if err != nil {
+			return err
+		}
+
+		if err := m.Upload(f.Path, bytes.NewReader(plaintext)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envelope header layout: a 2-byte big-endian length prefix for the
+// wrapped data key, followed by the wrapped key and then the ciphertext.
+func envelope(wrappedKey, ciphertext []byte) []byte {
+	n := len(wrappedKey)
+	buf := make([]byte, 2+n+len(ciphertext))
+	buf[0] = byte(n >> 8)
+	buf[1] = byte(n)
+	copy(buf[2:], wrappedKey)
+	copy(buf[2+n:], ciphertext)
+	return buf
+}
+
+func unenvelope(b []byte) (wrappedKey, ciphertext []byte, err error) {
+	if len(b) < 2 {
+		return nil, nil, fmt.Errorf("sneaker: truncated object")
+	}
+	n := int(b[0])<<8 | int(b[1])
+	if len(b) < 2+n {
+		return nil, nil, fmt.Errorf("sneaker: truncated object")
+	}
+	return b[2 : 2+n], b[2+n:], nil
+}
+
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(randReader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("sneaker: truncated ciphertext")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
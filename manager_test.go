@@ -0,0 +1,103 @@
+package sneaker
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestManagerUploadDownloadRoundTrip(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a/b", strings.NewReader("hunter2")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	secrets, err := m.Download([]string{"a/b"})
+	if err != nil {
+		t.Fatalf("Download: %s", err)
+	}
+	if string(secrets["a/b"]) != "hunter2" {
+		t.Errorf("secrets[a/b] = %q, want hunter2", secrets["a/b"])
+	}
+}
+
+func TestManagerListFiltersByPattern(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	for _, p := range []string{"prod/db", "prod/api", "staging/db"} {
+		if err := m.Upload(p, strings.NewReader("secret")); err != nil {
+			t.Fatalf("Upload %s: %s", p, err)
+		}
+	}
+
+	got, err := m.List("db")
+	if err != nil {
+		t.Fatalf("List: %s", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d files, want 2: %v", len(got), got)
+	}
+}
+
+func TestManagerRm(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("secret")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+	if err := m.Rm("a"); err != nil {
+		t.Fatalf("Rm: %s", err)
+	}
+	if _, err := m.Download([]string{"a"}); err == nil {
+		t.Fatal("expected Download to fail after Rm, got nil error")
+	}
+}
+
+// TestManagerRotateReencryptsUnderNewDataKey confirms Rotate replaces every
+// matching secret's envelope (and thus its wrapped data key) while leaving
+// the plaintext unchanged, using memKeyService's "wrapped key == plaintext
+// key" behavior to tell the two envelopes apart.
+func TestManagerRotateReencryptsUnderNewDataKey(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("hunter2")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	before, err := m.Objects.Get("a")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	beforeBytes, err := ioutil.ReadAll(before)
+	before.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+
+	if err := m.Rotate("a", nil); err != nil {
+		t.Fatalf("Rotate: %s", err)
+	}
+
+	after, err := m.Objects.Get("a")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	afterBytes, err := ioutil.ReadAll(after)
+	after.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+
+	if string(beforeBytes) == string(afterBytes) {
+		t.Error("expected Rotate to change the stored envelope, got identical bytes")
+	}
+
+	secrets, err := m.Download([]string{"a"})
+	if err != nil {
+		t.Fatalf("Download: %s", err)
+	}
+	if string(secrets["a"]) != "hunter2" {
+		t.Errorf("secrets[a] = %q, want hunter2 after Rotate", secrets["a"])
+	}
+}
@@ -0,0 +1,173 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// packHeader precedes the ciphertext in a Pack bundle. WrappedKey is the
+// data key wrapped for the Manager's configured KMS key; Stanzas holds the
+// same data key wrapped independently for each configured Recipient, so
+// the bundle can be unpacked without access to KMS.
+type packHeader struct {
+	WrappedKey []byte            `json:"wrapped_key"`
+	Stanzas    []recipientStanza `json:"recipients,omitempty"`
+}
+
+// Pack writes secrets as a single gzipped tar archive, encrypted under one
+// freshly generated data key, to w. The data key is wrapped for the
+// Manager's KMS key and, if any are configured, every Recipient.
+func (m *Manager) Pack(secrets map[string][]byte, context map[string]string, w io.Writer) (err error) {
+	defer func() { m.audit("pack", "", "", err) }()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	for path, contents := range secrets {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: path,
+			Mode: 0600,
+			Size: int64(len(contents)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(contents); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	key, wrappedKey, err := m.Keys.GenerateDataKey(m.KeyID, context)
+	if err != nil {
+		return fmt.Errorf("sneaker: unable to generate data key: %s", err)
+	}
+
+	header := packHeader{WrappedKey: wrappedKey}
+	for _, recipient := range m.Recipients {
+		wrapped, err := recipient.Wrap(key)
+		if err != nil {
+			return fmt.Errorf("sneaker: unable to wrap data key for %s %s: %s", recipient.Type(), recipient.ID(), err)
+		}
+		header.Stanzas = append(header.Stanzas, recipientStanza{
+			Type:       recipient.Type(),
+			ID:         recipient.ID(),
+			WrappedKey: wrapped,
+		})
+	}
+
+	ciphertext, err := encrypt(key, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(headerBytes)))
+
+	if _, err := w.Write(lenPrefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(headerBytes); err != nil {
+		return err
+	}
+	_, err = w.Write(ciphertext)
+	return err
+}
+
+// Unpack decrypts a bundle written by Pack and returns a reader over its
+// contents as a gzipped tar archive. It tries KMS first; if that fails
+// (for instance because no AWS credentials are available), it falls back
+// to any recipient stanza it can unwrap locally: an age identity file at
+// SNEAKER_AGE_IDENTITY, or the running gpg-agent.
+func (m *Manager) Unpack(context map[string]string, r io.Reader) (reader io.Reader, err error) {
+	defer func() { m.audit("unpack", "", "", err) }()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	header, ciphertext, err := readPackHeader(b)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.unwrapDataKey(header, context)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := decrypt(key, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(plaintext), nil
+}
+
+func (m *Manager) unwrapDataKey(header packHeader, context map[string]string) ([]byte, error) {
+	if key, err := m.Keys.Decrypt(header.WrappedKey, context); err == nil {
+		return key, nil
+	}
+
+	var lastErr error
+	for _, stanza := range header.Stanzas {
+		var key []byte
+		var err error
+
+		switch stanza.Type {
+		case "age":
+			key, err = unwrapAge(stanza.WrappedKey, os.Getenv("SNEAKER_AGE_IDENTITY"))
+		case "pgp":
+			key, err = unwrapPGP(stanza.WrappedKey)
+		default:
+			err = fmt.Errorf("sneaker: unknown recipient type %q", stanza.Type)
+		}
+
+		if err == nil {
+			return key, nil
+		}
+		lastErr = err
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("sneaker: no recipient stanzas in bundle")
+	}
+	return nil, fmt.Errorf("sneaker: unable to decrypt data key: %s", lastErr)
+}
+
+func readPackHeader(b []byte) (packHeader, []byte, error) {
+	if len(b) < 4 {
+		return packHeader{}, nil, fmt.Errorf("sneaker: truncated bundle")
+	}
+
+	n := binary.BigEndian.Uint32(b[:4])
+	if uint32(len(b)-4) < n {
+		return packHeader{}, nil, fmt.Errorf("sneaker: truncated bundle")
+	}
+
+	var header packHeader
+	if err := json.Unmarshal(b[4:4+n], &header); err != nil {
+		return packHeader{}, nil, fmt.Errorf("sneaker: malformed bundle header: %s", err)
+	}
+
+	return header, b[4+n:], nil
+}
@@ -0,0 +1,236 @@
+package sneaker
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ageHKDFInfo is the HKDF info string the age spec uses to derive an
+// X25519 stanza's wrap key from the ECDH shared secret. Using the raw
+// shared secret directly as a key, with no HKDF step, is weaker than what
+// the spec actually requires.
+const ageHKDFInfo = "age-encryption.org/v1/X25519"
+
+// ageWrapKey derives the ChaCha20-Poly1305 key an X25519 stanza uses to
+// wrap or unwrap a data key, per the age spec: HKDF-SHA256 over the ECDH
+// shared secret, salted with the ephemeral and recipient public keys.
+func ageWrapKey(shared, ephemeralPub, recipientPub []byte) ([]byte, error) {
+	salt := append(append([]byte{}, ephemeralPub...), recipientPub...)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(ageHKDFInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Recipient independently wraps a Pack bundle's data key, so the bundle can
+// be unpacked by anyone holding the matching private key, without needing
+// access to KMS. sneaker ships age (NewAgeRecipient) and PGP
+// (NewPGPRecipient) implementations.
+type Recipient interface {
+	// Type identifies the recipient's stanza format, e.g. "age" or "pgp".
+	Type() string
+
+	// ID identifies the specific recipient within its type, e.g. an age
+	// public key or a PGP fingerprint.
+	ID() string
+
+	// Wrap encrypts dataKey for this recipient.
+	Wrap(dataKey []byte) (wrappedKey []byte, err error)
+}
+
+// recipientStanza is the on-disk representation of a wrapped data key
+// carried in a Pack bundle's header.
+type recipientStanza struct {
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	WrappedKey []byte `json:"wrapped_key"`
+}
+
+// ageRecipient wraps data keys for a single age X25519 public key, using
+// an ephemeral X25519 key pair and ChaCha20-Poly1305 per the age spec.
+type ageRecipient struct {
+	publicKey [32]byte
+	id        string
+}
+
+// NewAgeRecipient returns a Recipient that wraps data keys for the holder
+// of the age identity matching publicKey (the bech32 "age1..." string,
+// decoded to its raw 32-byte X25519 public key by the caller).
+func NewAgeRecipient(id string, publicKey [32]byte) Recipient {
+	return &ageRecipient{publicKey: publicKey, id: id}
+}
+
+func (r *ageRecipient) Type() string { return "age" }
+func (r *ageRecipient) ID() string   { return r.id }
+
+func (r *ageRecipient) Wrap(dataKey []byte) ([]byte, error) {
+	var ephemeralPriv [32]byte
+	if _, err := io.ReadFull(rand.Reader, ephemeralPriv[:]); err != nil {
+		return nil, err
+	}
+
+	ephemeralPub, err := curve25519.X25519(ephemeralPriv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	shared, err := curve25519.X25519(ephemeralPriv[:], r.publicKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ageWrapKey(shared, ephemeralPub, r.publicKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	sealed := aead.Seal(nil, nonce, dataKey, nil)
+
+	// the wrapped key carries the ephemeral public key alongside the
+	// sealed data key, so the recipient can recompute the shared secret.
+	return append(ephemeralPub, sealed...), nil
+}
+
+// unwrapAge decrypts a stanza wrapped by ageRecipient.Wrap using the X25519
+// identity loaded from the file at SNEAKER_AGE_IDENTITY.
+func unwrapAge(wrappedKey []byte, identityPath string) ([]byte, error) {
+	if identityPath == "" {
+		return nil, fmt.Errorf("sneaker: SNEAKER_AGE_IDENTITY not set")
+	}
+	if len(wrappedKey) < 32 {
+		return nil, fmt.Errorf("sneaker: truncated age stanza")
+	}
+
+	identity, err := ioutil.ReadFile(identityPath)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := parseAgeIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeralPub, sealed := wrappedKey[:32], wrappedKey[32:]
+
+	shared, err := curve25519.X25519(priv[:], ephemeralPub)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientPub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ageWrapKey(shared, ephemeralPub, recipientPub)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+// pgpRecipient wraps data keys under a PGP public key.
+type pgpRecipient struct {
+	entity      *openpgp.Entity
+	fingerprint string
+}
+
+// NewPGPRecipient returns a Recipient that wraps data keys for the holder
+// of the private key matching the given armored PGP public key.
+func NewPGPRecipient(fingerprint string, armoredPublicKey io.Reader) (Recipient, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(armoredPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("sneaker: no PGP keys found")
+	}
+	return &pgpRecipient{entity: keyring[0], fingerprint: fingerprint}, nil
+}
+
+func (r *pgpRecipient) Type() string { return "pgp" }
+func (r *pgpRecipient) ID() string   { return r.fingerprint }
+
+func (r *pgpRecipient) Wrap(dataKey []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := openpgp.Encrypt(&buf, []*openpgp.Entity{r.entity}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unwrapPGP decrypts a stanza wrapped by pgpRecipient.Wrap using the
+// running gpg-agent, shelling out to `gpg --decrypt` the same way the gpg
+// CLI itself does.
+func unwrapPGP(wrappedKey []byte) ([]byte, error) {
+	cmd := exec.Command("gpg", "--quiet", "--decrypt")
+	cmd.Stdin = bytes.NewReader(wrappedKey)
+	cmd.Stderr = os.Stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sneaker: gpg-agent unable to decrypt: %s", err)
+	}
+	return out, nil
+}
+
+// ageIdentityHRP is the bech32 human-readable part of an age identity
+// ("AGE-SECRET-KEY-1...", lower-cased since bech32 strings are
+// case-insensitive aside from not being mixed-case).
+const ageIdentityHRP = "age-secret-key-"
+
+// parseAgeIdentity extracts the raw 32-byte X25519 private key from an age
+// identity file, which holds a single bech32 "AGE-SECRET-KEY-1..." line.
+func parseAgeIdentity(identity []byte) ([32]byte, error) {
+	var key [32]byte
+	for _, line := range strings.Split(string(identity), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hrp, decoded, err := DecodeBech32(line)
+		if err != nil {
+			return key, fmt.Errorf("sneaker: malformed age identity: %s", err)
+		}
+		if hrp != ageIdentityHRP || len(decoded) != 32 {
+			return key, fmt.Errorf("sneaker: malformed age identity")
+		}
+		copy(key[:], decoded)
+		return key, nil
+	}
+	return key, fmt.Errorf("sneaker: no identity found in SNEAKER_AGE_IDENTITY")
+}
@@ -0,0 +1,240 @@
+package sneaker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// encodeBech32 is the inverse of DecodeBech32 (BIP-0173), used only by
+// tests to build synthetic age keys/identities without shelling out to
+// age-keygen.
+func encodeBech32(hrp string, data []byte) (string, error) {
+	values, err := bech32ConvertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := bech32CreateChecksum(hrp, values)
+	combined := append(values, checksum...)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range combined {
+		sb.WriteByte(bech32Charset[v])
+	}
+	return sb.String(), nil
+}
+
+func bech32CreateChecksum(hrp string, values []byte) []byte {
+	vs := append(bech32HRPExpand(hrp), values...)
+	vs = append(vs, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(vs) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte((mod >> uint(5*(5-i))) & 31)
+	}
+	return checksum
+}
+
+func TestBech32EncodeDecodeRoundTrip(t *testing.T) {
+	data := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, data); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := encodeBech32("age", data)
+	if err != nil {
+		t.Fatalf("encodeBech32: %s", err)
+	}
+
+	hrp, decoded, err := DecodeBech32(encoded)
+	if err != nil {
+		t.Fatalf("DecodeBech32: %s", err)
+	}
+	if hrp != "age" {
+		t.Errorf("hrp = %q, want age", hrp)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Errorf("decoded = %x, want %x", decoded, data)
+	}
+}
+
+func writeAgeIdentity(t *testing.T, priv [32]byte) string {
+	t.Helper()
+
+	identity, err := encodeBech32(ageIdentityHRP, priv[:])
+	if err != nil {
+		t.Fatalf("encodeBech32: %s", err)
+	}
+
+	f, err := ioutil.TempFile("", "sneaker-age-identity-")
+	if err != nil {
+		t.Fatalf("TempFile: %s", err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	if _, err := f.WriteString(identity + "\n"); err != nil {
+		t.Fatalf("WriteString: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	return f.Name()
+}
+
+func TestAgeRecipientRoundTrip(t *testing.T) {
+	var priv [32]byte
+	if _, err := io.ReadFull(rand.Reader, priv[:]); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubArr [32]byte
+	copy(pubArr[:], pub)
+
+	recipient := NewAgeRecipient("age1test", pubArr)
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := recipient.Wrap(dataKey)
+	if err != nil {
+		t.Fatalf("Wrap: %s", err)
+	}
+
+	identityPath := writeAgeIdentity(t, priv)
+
+	got, err := unwrapAge(wrapped, identityPath)
+	if err != nil {
+		t.Fatalf("unwrapAge: %s", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Errorf("unwrapAge = %x, want %x", got, dataKey)
+	}
+}
+
+// unreachableKMS is a KeyService whose Decrypt always fails, the way a real
+// KMS does when there are no AWS credentials available, so tests can
+// exercise Manager.Unpack's fallback to a Recipient stanza.
+type unreachableKMS struct{}
+
+func (unreachableKMS) GenerateDataKey(keyID string, context map[string]string) (plaintext, ciphertext []byte, err error) {
+	return memKeyService{}.GenerateDataKey(keyID, context)
+}
+
+func (unreachableKMS) Decrypt(ciphertext []byte, context map[string]string) ([]byte, error) {
+	return nil, fmt.Errorf("sneaker: no AWS credentials available")
+}
+
+// TestPackUnpackFallsBackToAgeRecipient confirms Unpack can recover a
+// bundle's data key from an age Recipient stanza when KMS itself is
+// unreachable, the scenario Recipients exists for: unpacking on a laptop
+// with no AWS credentials.
+func TestPackUnpackFallsBackToAgeRecipient(t *testing.T) {
+	var priv [32]byte
+	if _, err := io.ReadFull(rand.Reader, priv[:]); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubArr [32]byte
+	copy(pubArr[:], pub)
+
+	m := &Manager{
+		Keys:       unreachableKMS{},
+		KeyID:      "test-key",
+		Recipients: []Recipient{NewAgeRecipient("age1test", pubArr)},
+	}
+
+	secrets := map[string][]byte{"a": []byte("hunter2")}
+
+	var buf bytes.Buffer
+	if err := m.Pack(secrets, nil, &buf); err != nil {
+		t.Fatalf("Pack: %s", err)
+	}
+
+	identityPath := writeAgeIdentity(t, priv)
+	t.Setenv("SNEAKER_AGE_IDENTITY", identityPath)
+
+	r, err := m.Unpack(nil, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Unpack: %s", err)
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %s", err)
+	}
+	tr := tar.NewReader(gr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatalf("tar Next: %s", err)
+	}
+	if hdr.Name != "a" {
+		t.Fatalf("tar entry = %q, want a", hdr.Name)
+	}
+
+	got, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("ReadAll: %s", err)
+	}
+	if string(got) != "hunter2" {
+		t.Errorf("got %q, want hunter2", got)
+	}
+}
+
+// TestAgeRecipientWrongIdentityFails confirms a stanza wrapped for one
+// recipient can't be unwrapped with a different identity's private key.
+func TestAgeRecipientWrongIdentityFails(t *testing.T) {
+	var priv [32]byte
+	if _, err := io.ReadFull(rand.Reader, priv[:]); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubArr [32]byte
+	copy(pubArr[:], pub)
+
+	recipient := NewAgeRecipient("age1test", pubArr)
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := recipient.Wrap(dataKey)
+	if err != nil {
+		t.Fatalf("Wrap: %s", err)
+	}
+
+	var otherPriv [32]byte
+	if _, err := io.ReadFull(rand.Reader, otherPriv[:]); err != nil {
+		t.Fatal(err)
+	}
+	identityPath := writeAgeIdentity(t, otherPriv)
+
+	if _, err := unwrapAge(wrapped, identityPath); err == nil {
+		t.Fatal("expected unwrapAge to reject a stanza wrapped for a different recipient, got nil error")
+	}
+}
@@ -0,0 +1,92 @@
+package sneaker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/awslabs/aws-sdk-go/aws"
+	"github.com/awslabs/aws-sdk-go/gen/s3"
+)
+
+// s3Store is an ObjectStore backed by an S3 bucket and key prefix.
+type s3Store struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+// NewS3Store returns an ObjectStore which stores objects in bucket under
+// prefix, using client to talk to S3.
+func NewS3Store(client *s3.S3, bucket, prefix string) ObjectStore {
+	return &s3Store{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (s *s3Store) List(prefix string) ([]File, error) {
+	resp, err := s.client.ListObjects(&s3.ListObjectsRequest{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(path.Join(s.prefix, prefix)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0, len(resp.Contents))
+	for _, o := range resp.Contents {
+		files = append(files, File{
+			Path:         stripPrefix(*o.Key, s.prefix),
+			LastModified: *o.LastModified,
+			Size:         *o.Size,
+			ETag:         *o.ETag,
+		})
+	}
+	return files, nil
+}
+
+func (s *s3Store) Put(p string, r io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.PutObject(&s3.PutObjectRequest{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, p)),
+		Body:   bytes.NewReader(b),
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.ETag == nil {
+		return "", nil
+	}
+	return *resp.ETag, nil
+}
+
+func (s *s3Store) Get(p string) (io.ReadCloser, error) {
+	resp, err := s.client.GetObject(&s3.GetObjectRequest{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, p)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Store) Delete(p string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectRequest{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path.Join(s.prefix, p)),
+	})
+	return err
+}
+
+func stripPrefix(key, prefix string) string {
+	key = key[len(prefix):]
+	for len(key) > 0 && key[0] == '/' {
+		key = key[1:]
+	}
+	return key
+}
@@ -0,0 +1,200 @@
+package sneaker
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+)
+
+// sopsDocument is the on-disk layout written by PackSOPS: every secret is
+// encrypted individually, so the result is diffable and safe to check into
+// git, unlike the single-data-key tarball Pack produces.
+type sopsDocument struct {
+	Secrets []sopsSecret `json:"secrets"`
+	Sops    sopsMetadata `json:"sops"`
+}
+
+type sopsSecret struct {
+	Path   string `json:"path"`
+	Enc    string `json:"enc"`
+	EncKey string `json:"enc_key"`
+	Nonce  string `json:"nonce"`
+	Tag    string `json:"tag"`
+}
+
+type sopsMetadata struct {
+	KeyID   string            `json:"kms_arn"`
+	Context map[string]string `json:"encryption_context,omitempty"`
+	Created time.Time         `json:"created"`
+	MacKey  string            `json:"mac_key"`
+	Mac     string            `json:"mac"`
+}
+
+// PackSOPS writes secrets as a SOPS-style document to w: each secret is
+// encrypted under its own data key, and a MAC over every plaintext value
+// (keyed by a separately wrapped MAC key) detects tampering or reordering
+// of entries on Unpack.
+func (m *Manager) PackSOPS(secrets map[string][]byte, context map[string]string, w io.Writer) (err error) {
+	defer func() { m.audit("pack", "", "", err) }()
+
+	paths := make([]string, 0, len(secrets))
+	for path := range secrets {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	doc := sopsDocument{
+		Secrets: make([]sopsSecret, 0, len(paths)),
+		Sops: sopsMetadata{
+			KeyID:   m.KeyID,
+			Context: context,
+			Created: nowFunc(),
+		},
+	}
+
+	macKey, wrappedMacKey, err := m.Keys.GenerateDataKey(m.KeyID, context)
+	if err != nil {
+		return fmt.Errorf("sneaker: unable to generate mac key: %s", err)
+	}
+	doc.Sops.MacKey = base64.StdEncoding.EncodeToString(wrappedMacKey)
+
+	mac := hmac.New(sha256.New, macKey)
+
+	for _, path := range paths {
+		plaintext := secrets[path]
+
+		key, wrappedKey, err := m.Keys.GenerateDataKey(m.KeyID, context)
+		if err != nil {
+			return fmt.Errorf("sneaker: unable to generate data key for %s: %s", path, err)
+		}
+
+		nonce, ciphertext, tag, err := sealGCM(key, plaintext)
+		if err != nil {
+			return err
+		}
+
+		mac.Write([]byte(path))
+		mac.Write(plaintext)
+
+		doc.Secrets = append(doc.Secrets, sopsSecret{
+			Path:   path,
+			Enc:    base64.StdEncoding.EncodeToString(ciphertext),
+			EncKey: base64.StdEncoding.EncodeToString(wrappedKey),
+			Nonce:  base64.StdEncoding.EncodeToString(nonce),
+			Tag:    base64.StdEncoding.EncodeToString(tag),
+		})
+	}
+
+	doc.Sops.Mac = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// UnpackSOPS reads a document written by PackSOPS from r, verifies its MAC,
+// and returns the decrypted secrets keyed by path. If paths is non-empty,
+// only those secrets are returned; every secret is still decrypted, since
+// the MAC covers all plaintext values.
+func (m *Manager) UnpackSOPS(context map[string]string, r io.Reader, paths ...string) (secrets map[string][]byte, err error) {
+	defer func() { m.audit("unpack", "", "", err) }()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc sopsDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("sneaker: unable to parse sops document: %s", err)
+	}
+
+	wrappedMacKey, err := base64.StdEncoding.DecodeString(doc.Sops.MacKey)
+	if err != nil {
+		return nil, err
+	}
+	macKey, err := m.Keys.Decrypt(wrappedMacKey, context)
+	if err != nil {
+		return nil, fmt.Errorf("sneaker: unable to decrypt mac key: %s", err)
+	}
+	expectedMac, err := base64.StdEncoding.DecodeString(doc.Sops.Mac)
+	if err != nil {
+		return nil, err
+	}
+
+	want := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		want[p] = true
+	}
+
+	plaintexts := make(map[string][]byte, len(doc.Secrets))
+	mac := hmac.New(sha256.New, macKey)
+	for _, s := range doc.Secrets {
+		wrappedKey, err := base64.StdEncoding.DecodeString(s.EncKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := m.Keys.Decrypt(wrappedKey, context)
+		if err != nil {
+			return nil, fmt.Errorf("sneaker: unable to decrypt data key for %s: %s", s.Path, err)
+		}
+
+		ciphertext, err := base64.StdEncoding.DecodeString(s.Enc)
+		if err != nil {
+			return nil, err
+		}
+		nonce, err := base64.StdEncoding.DecodeString(s.Nonce)
+		if err != nil {
+			return nil, err
+		}
+		tag, err := base64.StdEncoding.DecodeString(s.Tag)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := openGCM(key, nonce, ciphertext, tag)
+		if err != nil {
+			return nil, fmt.Errorf("sneaker: unable to decrypt %s: %s", s.Path, err)
+		}
+
+		mac.Write([]byte(s.Path))
+		mac.Write(plaintext)
+
+		if len(want) == 0 || want[s.Path] {
+			plaintexts[s.Path] = plaintext
+		}
+	}
+
+	if !hmac.Equal(mac.Sum(nil), expectedMac) {
+		return nil, fmt.Errorf("sneaker: sops document failed MAC verification, possible tampering")
+	}
+
+	return plaintexts, nil
+}
+
+// nowFunc is a var so tests can freeze time.
+var nowFunc = time.Now
+
+func sealGCM(key, plaintext []byte) (nonce, ciphertext, tag []byte, err error) {
+	sealed, err := encrypt(key, plaintext)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// encrypt prepends a 12-byte nonce and appends a 16-byte GCM tag.
+	nonce = sealed[:12]
+	body := sealed[12:]
+	ciphertext = body[:len(body)-16]
+	tag = body[len(body)-16:]
+	return nonce, ciphertext, tag, nil
+}
+
+func openGCM(key, nonce, ciphertext, tag []byte) ([]byte, error) {
+	sealed := append(append(append([]byte{}, nonce...), ciphertext...), tag...)
+	return decrypt(key, sealed)
+}
@@ -0,0 +1,90 @@
+package sneaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestPackUnpackSOPSRoundTrip(t *testing.T) {
+	m := &Manager{Keys: memKeyService{}, KeyID: "test-key"}
+
+	secrets := map[string][]byte{
+		"prod/db/password": []byte("hunter2"),
+		"prod/api/token":   []byte("s3cr3t"),
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackSOPS(secrets, nil, &buf); err != nil {
+		t.Fatalf("PackSOPS: %s", err)
+	}
+
+	got, err := m.UnpackSOPS(nil, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("UnpackSOPS: %s", err)
+	}
+
+	if len(got) != len(secrets) {
+		t.Fatalf("got %d secrets, want %d", len(got), len(secrets))
+	}
+	for path, want := range secrets {
+		if !bytes.Equal(got[path], want) {
+			t.Errorf("secret %s = %q, want %q", path, got[path], want)
+		}
+	}
+}
+
+func TestUnpackSOPSSelectsRequestedPaths(t *testing.T) {
+	m := &Manager{Keys: memKeyService{}, KeyID: "test-key"}
+
+	secrets := map[string][]byte{
+		"a": []byte("one"),
+		"b": []byte("two"),
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackSOPS(secrets, nil, &buf); err != nil {
+		t.Fatalf("PackSOPS: %s", err)
+	}
+
+	got, err := m.UnpackSOPS(nil, bytes.NewReader(buf.Bytes()), "a")
+	if err != nil {
+		t.Fatalf("UnpackSOPS: %s", err)
+	}
+	if len(got) != 1 || string(got["a"]) != "one" {
+		t.Fatalf("got %v, want only a=one", got)
+	}
+}
+
+// TestUnpackSOPSDetectsReorder confirms UnpackSOPS's trailing MAC catches a
+// document whose entries have been reordered without touching any
+// individual secret's ciphertext, not just outright ciphertext tampering
+// (already caught by each entry's own GCM tag).
+func TestUnpackSOPSDetectsReorder(t *testing.T) {
+	m := &Manager{Keys: memKeyService{}, KeyID: "test-key"}
+
+	secrets := map[string][]byte{
+		"a": []byte("one"),
+		"b": []byte("two"),
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackSOPS(secrets, nil, &buf); err != nil {
+		t.Fatalf("PackSOPS: %s", err)
+	}
+
+	var doc sopsDocument
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	doc.Secrets[0].Path, doc.Secrets[1].Path = doc.Secrets[1].Path, doc.Secrets[0].Path
+
+	tampered, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+
+	if _, err := m.UnpackSOPS(nil, bytes.NewReader(tampered)); err == nil {
+		t.Fatal("expected UnpackSOPS to reject a reordered document, got nil error")
+	}
+}
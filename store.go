@@ -0,0 +1,40 @@
+package sneaker
+
+import "io"
+
+// ObjectStore is a backend capable of storing and retrieving the encrypted
+// bytes of a secret. Manager uses it for all bulk storage; sneaker ships an
+// S3 implementation (see NewS3Store) and a HashiCorp Vault implementation
+// (see NewVaultStore).
+type ObjectStore interface {
+	// List returns the files whose path begins with prefix.
+	List(prefix string) ([]File, error)
+
+	// Put stores the contents of r at path, replacing anything already
+	// there, and returns the resulting object's ETag, if the backend has
+	// one (e.g. S3). Backends with no such concept (e.g. Vault) return "".
+	Put(path string, r io.Reader) (etag string, err error)
+
+	// Get returns a reader for the contents stored at path.
+	Get(path string) (io.ReadCloser, error)
+
+	// Delete removes the object at path.
+	Delete(path string) error
+}
+
+// KeyService performs envelope encryption: it mints data keys used to
+// encrypt secrets locally, and unwraps those data keys again on download.
+// Manager uses it instead of encrypting secrets directly, so that the bulk
+// of the ciphertext never has to pass through the key service. sneaker
+// ships a KMS implementation (see NewKMSKeyService) and a HashiCorp Vault
+// Transit implementation (see NewVaultStore).
+type KeyService interface {
+	// GenerateDataKey returns a new plaintext data key and its ciphertext,
+	// which was encrypted under keyID using context as additional
+	// authenticated data.
+	GenerateDataKey(keyID string, context map[string]string) (plaintext, ciphertext []byte, err error)
+
+	// Decrypt returns the plaintext data key for ciphertext, verifying it
+	// against context.
+	Decrypt(ciphertext []byte, context map[string]string) (plaintext []byte, err error)
+}
@@ -0,0 +1,425 @@
+package sneaker
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// streamChunkSize is how much plaintext goes into each AES-GCM frame.
+// Bounding it keeps UnpackStream's memory use constant regardless of how
+// large a secret is. PackStream reads each secret whole before chunking
+// it, so its memory use grows with the largest single secret; Pack/Unpack
+// buffer an entire bundle in memory.
+const streamChunkSize = 1 << 20 // 1 MiB
+
+var streamMagic = [4]byte{'S', 'N', 'K', 'C'}
+
+const streamVersion = 1
+
+// PackStream writes the secrets at paths to w using a framed, chunked
+// format: a header carrying the KMS-wrapped data key, followed by one
+// section per secret (its path, then a sequence of
+// independently-authenticated chunk frames), followed by a trailer frame
+// with an HMAC over every file's path and ciphertext frames.
+//
+// Unlike Pack, which holds every secret in the bundle in memory before
+// writing any of it out, PackStream holds one secret's plaintext at a
+// time: each secret is downloaded and decrypted whole, then written to w
+// a chunk at a time under the bundle's data key.
+func (m *Manager) PackStream(paths []string, context map[string]string, w io.Writer) (err error) {
+	defer func() { m.audit("pack", "", "", err) }()
+
+	key, wrappedKey, err := m.Keys.GenerateDataKey(m.KeyID, context)
+	if err != nil {
+		return fmt.Errorf("sneaker: unable to generate data key: %s", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+
+	if err := writeStreamHeader(w, wrappedKey, len(sorted)); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, macKeyFor(key))
+
+	for _, path := range sorted {
+		if err := m.packStreamFile(w, mac, gcm, path); err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(mac.Sum(nil))
+	return err
+}
+
+func (m *Manager) packStreamFile(w io.Writer, mac io.Writer, gcm cipher.AEAD, path string) error {
+	plaintext, err := m.download(path)
+	if err != nil {
+		return err
+	}
+
+	return writeStreamFile(w, mac, gcm, path, bytes.NewReader(plaintext))
+}
+
+func writeStreamHeader(w io.Writer, wrappedKey []byte, fileCount int) error {
+	if _, err := w.Write(streamMagic[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{streamVersion}); err != nil {
+		return err
+	}
+
+	var lenPrefix [2]byte
+	binary.BigEndian.PutUint16(lenPrefix[:], uint16(len(wrappedKey)))
+	if _, err := w.Write(lenPrefix[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(wrappedKey); err != nil {
+		return err
+	}
+
+	var countPrefix [2]byte
+	binary.BigEndian.PutUint16(countPrefix[:], uint16(fileCount))
+	_, err := w.Write(countPrefix[:])
+	return err
+}
+
+func writeStreamFile(w io.Writer, mac io.Writer, gcm cipher.AEAD, path string, r io.Reader) error {
+	var pathLenPrefix [2]byte
+	binary.BigEndian.PutUint16(pathLenPrefix[:], uint16(len(path)))
+	if _, err := w.Write(pathLenPrefix[:]); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, path); err != nil {
+		return err
+	}
+	if mac != nil {
+		mac.Write(pathLenPrefix[:])
+		io.WriteString(mac, path)
+	}
+
+	var base [4]byte
+	if _, err := io.ReadFull(randReader, base[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(base[:]); err != nil {
+		return err
+	}
+
+	return writeChunks(w, mac, gcm, base, r)
+}
+
+// writeChunks encrypts r as a sequence of chunked AES-GCM frames (a 4-byte
+// length prefix followed by ciphertext) under gcm, deriving each frame's
+// nonce from base and a monotonically increasing counter so no (key,
+// nonce) pair is ever reused. A zero-length frame terminates the sequence.
+// If mac is non-nil, every frame's ciphertext is also written to it, so
+// several files' frames can be folded into one trailer MAC.
+func writeChunks(w io.Writer, mac io.Writer, gcm cipher.AEAD, base [4]byte, r io.Reader) error {
+	buf := make([]byte, streamChunkSize)
+	var counter uint64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			nonce := streamNonce(base, counter)
+			ciphertext := gcm.Seal(nil, nonce, buf[:n], nil)
+
+			var chunkLenPrefix [4]byte
+			binary.BigEndian.PutUint32(chunkLenPrefix[:], uint32(len(ciphertext)))
+			if _, err := w.Write(chunkLenPrefix[:]); err != nil {
+				return err
+			}
+			if _, err := w.Write(ciphertext); err != nil {
+				return err
+			}
+			if mac != nil {
+				mac.Write(ciphertext)
+			}
+			counter++
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	var terminator [4]byte
+	_, err := w.Write(terminator[:])
+	return err
+}
+
+// readChunks decrypts a sequence of frames written by writeChunks from r,
+// writing the plaintext to w and feeding each frame's ciphertext to mac (if
+// non-nil) as it goes, until it reaches the terminator frame.
+func readChunks(r io.Reader, w io.Writer, mac io.Writer, gcm cipher.AEAD, base [4]byte) error {
+	var counter uint64
+	for {
+		var chunkLenPrefix [4]byte
+		if _, err := io.ReadFull(r, chunkLenPrefix[:]); err != nil {
+			return err
+		}
+
+		n := binary.BigEndian.Uint32(chunkLenPrefix[:])
+		if n == 0 {
+			return nil
+		}
+
+		ciphertext := make([]byte, n)
+		if _, err := io.ReadFull(r, ciphertext); err != nil {
+			return err
+		}
+		if mac != nil {
+			mac.Write(ciphertext)
+		}
+
+		nonce := streamNonce(base, counter)
+		counter++
+
+		plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return fmt.Errorf("sneaker: chunk failed authentication: %s", err)
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+	}
+}
+
+// streamNonce derives the per-chunk GCM nonce from a per-file random base
+// and a monotonically increasing chunk counter, so no (key, nonce) pair is
+// ever reused.
+func streamNonce(base [4]byte, counter uint64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, base[:])
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func macKeyFor(dataKey []byte) []byte {
+	sum := sha256.Sum256(append([]byte("sneaker-stream-mac"), dataKey...))
+	return sum[:]
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// spooledFile is one file of a bundle UnpackStream has already decrypted
+// and verified, with its plaintext spooled to a temp file rather than held
+// in memory.
+type spooledFile struct {
+	path string
+	file *os.File
+}
+
+// StreamReader serves the files of a bundle UnpackStream has already
+// decrypted and verified, one at a time, the way archive/tar.Reader is
+// used: call Next to advance to each file's path, then Read to read its
+// plaintext.
+type StreamReader struct {
+	files []spooledFile
+	idx   int
+	cur   *os.File
+}
+
+// UnpackStream reads a bundle written by PackStream from r, decrypting and
+// authenticating every chunk frame and verifying the trailing HMAC over
+// the whole bundle before it returns — the same discipline UnpackSOPS
+// uses, so a truncated, reordered, or tampered bundle is rejected before
+// any of its plaintext is readable, rather than after some of it has
+// already been written out by StreamReader.
+//
+// UnpackStream never holds the whole bundle in memory: each file's
+// plaintext is decrypted a chunk at a time and spooled to its own temp
+// file as it's verified. Call Close on the returned StreamReader once
+// you're done with it to remove those temp files.
+func (m *Manager) UnpackStream(context map[string]string, r io.Reader) (sr *StreamReader, err error) {
+	defer func() { m.audit("unpack", "", "", err) }()
+
+	wrappedKey, fileCount, err := readStreamHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.Keys.Decrypt(wrappedKey, context)
+	if err != nil {
+		return nil, fmt.Errorf("sneaker: unable to decrypt data key: %s", err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, macKeyFor(key))
+	files := make([]spooledFile, 0, fileCount)
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				f.file.Close()
+				os.Remove(f.file.Name())
+			}
+		}
+	}()
+
+	for i := 0; i < fileCount; i++ {
+		path, f, err := spoolStreamFile(r, mac, gcm)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, spooledFile{path: path, file: f})
+	}
+
+	trailer := make([]byte, mac.Size())
+	if _, err := io.ReadFull(r, trailer); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(trailer, mac.Sum(nil)) {
+		return nil, fmt.Errorf("sneaker: streamed bundle failed MAC verification, possible tampering")
+	}
+
+	for _, f := range files {
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return &StreamReader{files: files}, nil
+}
+
+func spoolStreamFile(r io.Reader, mac io.Writer, gcm cipher.AEAD) (path string, f *os.File, err error) {
+	var pathLenPrefix [2]byte
+	if _, err := io.ReadFull(r, pathLenPrefix[:]); err != nil {
+		return "", nil, err
+	}
+
+	pathBytes := make([]byte, binary.BigEndian.Uint16(pathLenPrefix[:]))
+	if _, err := io.ReadFull(r, pathBytes); err != nil {
+		return "", nil, err
+	}
+	if mac != nil {
+		mac.Write(pathLenPrefix[:])
+		mac.Write(pathBytes)
+	}
+
+	var base [4]byte
+	if _, err := io.ReadFull(r, base[:]); err != nil {
+		return "", nil, err
+	}
+
+	f, err = ioutil.TempFile("", "sneaker-stream-")
+	if err != nil {
+		return "", nil, err
+	}
+
+	if err := readChunks(r, f, mac, gcm, base); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", nil, err
+	}
+
+	return string(pathBytes), f, nil
+}
+
+func readStreamHeader(r io.Reader) (wrappedKey []byte, fileCount int, err error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, 0, err
+	}
+	if magic != streamMagic {
+		return nil, 0, fmt.Errorf("sneaker: not a streamed bundle")
+	}
+
+	var version [1]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return nil, 0, err
+	}
+	if version[0] != streamVersion {
+		return nil, 0, fmt.Errorf("sneaker: unsupported stream version %d", version[0])
+	}
+
+	var lenPrefix [2]byte
+	if _, err := io.ReadFull(r, lenPrefix[:]); err != nil {
+		return nil, 0, err
+	}
+
+	wrappedKey = make([]byte, binary.BigEndian.Uint16(lenPrefix[:]))
+	if _, err := io.ReadFull(r, wrappedKey); err != nil {
+		return nil, 0, err
+	}
+
+	var countPrefix [2]byte
+	if _, err := io.ReadFull(r, countPrefix[:]); err != nil {
+		return nil, 0, err
+	}
+
+	return wrappedKey, int(binary.BigEndian.Uint16(countPrefix[:])), nil
+}
+
+// Next advances to the next file in the bundle and returns its path,
+// returning io.EOF once every file has been read.
+func (sr *StreamReader) Next() (string, error) {
+	if sr.cur != nil {
+		sr.cur.Close()
+		sr.cur = nil
+	}
+
+	if sr.idx >= len(sr.files) {
+		return "", io.EOF
+	}
+
+	f := sr.files[sr.idx]
+	sr.idx++
+	sr.cur = f.file
+	return f.path, nil
+}
+
+// Read returns the current file's already-verified plaintext, returning
+// io.EOF once it's been fully read.
+func (sr *StreamReader) Read(p []byte) (int, error) {
+	if sr.cur == nil {
+		return 0, io.EOF
+	}
+	return sr.cur.Read(p)
+}
+
+// Close removes the temp files UnpackStream spooled this bundle's
+// plaintext into. Callers should call it once they're done with the
+// StreamReader.
+func (sr *StreamReader) Close() error {
+	if sr.cur != nil {
+		sr.cur.Close()
+		sr.cur = nil
+	}
+
+	var firstErr error
+	for _, f := range sr.files {
+		f.file.Close()
+		if err := os.Remove(f.file.Name()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,115 @@
+package sneaker
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPackUnpackStreamRoundTrip(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	secrets := map[string]string{
+		"a": "hello world",
+		// spans more than one chunk frame, to exercise writeChunks/readChunks
+		// past their first iteration.
+		"b": strings.Repeat("x", streamChunkSize+17),
+	}
+	for path, body := range secrets {
+		if err := m.Upload(path, strings.NewReader(body)); err != nil {
+			t.Fatalf("Upload %s: %s", path, err)
+		}
+	}
+
+	paths := make([]string, 0, len(secrets))
+	for p := range secrets {
+		paths = append(paths, p)
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackStream(paths, nil, &buf); err != nil {
+		t.Fatalf("PackStream: %s", err)
+	}
+
+	sr, err := m.UnpackStream(nil, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("UnpackStream: %s", err)
+	}
+	defer sr.Close()
+
+	got := make(map[string]string)
+	for {
+		path, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next: %s", err)
+		}
+
+		b, err := ioutil.ReadAll(sr)
+		if err != nil {
+			t.Fatalf("Read %s: %s", path, err)
+		}
+		got[path] = string(b)
+	}
+
+	if len(got) != len(secrets) {
+		t.Fatalf("got %d files, want %d", len(got), len(secrets))
+	}
+	for path, want := range secrets {
+		if got[path] != want {
+			t.Errorf("secret %s mismatch (len got=%d want=%d)", path, len(got[path]), len(want))
+		}
+	}
+}
+
+// TestUnpackStreamDetectsTamperedTrailer confirms a corrupted trailer HMAC
+// is caught before UnpackStream returns a StreamReader at all, rather than
+// after a caller has already read some of the bundle's plaintext.
+func TestUnpackStreamDetectsTamperedTrailer(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("hello world")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackStream([]string{"a"}, nil, &buf); err != nil {
+		t.Fatalf("PackStream: %s", err)
+	}
+
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	sr, err := m.UnpackStream(nil, bytes.NewReader(tampered))
+	if err == nil {
+		sr.Close()
+		t.Fatal("expected UnpackStream to reject a tampered trailer, got nil error")
+	}
+	if sr != nil {
+		t.Fatal("expected a nil StreamReader on verification failure")
+	}
+}
+
+func TestUnpackStreamDetectsTamperedChunk(t *testing.T) {
+	m := &Manager{Objects: newMemObjectStore(), Keys: memKeyService{}, KeyID: "test-key"}
+
+	if err := m.Upload("a", strings.NewReader("hello world, this is a secret")); err != nil {
+		t.Fatalf("Upload: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := m.PackStream([]string{"a"}, nil, &buf); err != nil {
+		t.Fatalf("PackStream: %s", err)
+	}
+
+	tampered := append([]byte{}, buf.Bytes()...)
+	tampered[len(tampered)/2] ^= 0xff
+
+	if _, err := m.UnpackStream(nil, bytes.NewReader(tampered)); err == nil {
+		t.Fatal("expected UnpackStream to reject a tampered chunk, got nil error")
+	}
+}
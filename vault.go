@@ -0,0 +1,172 @@
+package sneaker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// VaultStore is an ObjectStore and a KeyService backed by a single Vault
+// server: secrets are stored in the KV v2 engine mounted at Mount, and data
+// keys are generated and unwrapped using the Transit engine's TransitKey.
+//
+// It lets sneaker run against Vault instead of S3+KMS by setting
+// SNEAKER_BACKEND=vault (see cmd/sneaker's loadManager).
+type VaultStore struct {
+	Client     *vaultapi.Client
+	Mount      string
+	TransitKey string
+}
+
+// NewVaultStore returns a VaultStore using client, storing secrets under
+// the KV v2 engine mounted at mount and wrapping data keys with the
+// Transit engine key transitKey.
+func NewVaultStore(client *vaultapi.Client, mount, transitKey string) *VaultStore {
+	return &VaultStore{Client: client, Mount: mount, TransitKey: transitKey}
+}
+
+func (v *VaultStore) dataPath(p string) string {
+	return path.Join(v.Mount, "data", p)
+}
+
+// List returns every secret under prefix. Vault KV v2's LIST only returns
+// a path's immediate children, so List walks recursively into any child
+// that comes back with a trailing slash (Vault's way of marking it as
+// itself a directory, not a leaf) to match ObjectStore.List's contract of
+// a full recursive listing, the same as s3Store.List.
+func (v *VaultStore) List(prefix string) ([]File, error) {
+	secret, err := v.Client.Logical().List(path.Join(v.Mount, "metadata", prefix))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	keys, _ := secret.Data["keys"].([]interface{})
+	var files []File
+	for _, k := range keys {
+		name, ok := k.(string)
+		if !ok {
+			continue
+		}
+
+		p := path.Join(prefix, name)
+		if strings.HasSuffix(name, "/") {
+			children, err := v.List(p)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, children...)
+			continue
+		}
+
+		files = append(files, File{Path: p})
+	}
+	return files, nil
+}
+
+// Put stores the contents of r at p, returning "" for the ETag: Vault's KV
+// v2 engine has no equivalent concept, only an opaque version number.
+func (v *VaultStore) Put(p string, r io.Reader) (string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = v.Client.Logical().Write(v.dataPath(p), map[string]interface{}{
+		"data": map[string]interface{}{
+			"value": base64.StdEncoding.EncodeToString(b),
+		},
+	})
+	return "", err
+}
+
+func (v *VaultStore) Get(p string) (io.ReadCloser, error) {
+	secret, err := v.Client.Logical().Read(v.dataPath(p))
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("sneaker: no such secret: %s", p)
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+	encoded, _ := data["value"].(string)
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (v *VaultStore) Delete(p string) error {
+	_, err := v.Client.Logical().Delete(v.dataPath(p))
+	return err
+}
+
+func (v *VaultStore) GenerateDataKey(keyID string, context map[string]string) (plaintext, ciphertext []byte, err error) {
+	if v.TransitKey == "" {
+		return nil, nil, fmt.Errorf("sneaker: vault store has no transit key configured")
+	}
+
+	plaintext = make([]byte, 32)
+	if _, err := io.ReadFull(randReader, plaintext); err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := v.Client.Logical().Write(path.Join("transit", "encrypt", v.TransitKey), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+		"context":   encodeTransitContext(context),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, _ := secret.Data["ciphertext"].(string)
+	return plaintext, []byte(wrapped), nil
+}
+
+func (v *VaultStore) Decrypt(ciphertext []byte, context map[string]string) ([]byte, error) {
+	if v.TransitKey == "" {
+		return nil, fmt.Errorf("sneaker: vault store has no transit key configured")
+	}
+
+	secret, err := v.Client.Logical().Write(path.Join("transit", "decrypt", v.TransitKey), map[string]interface{}{
+		"ciphertext": string(ciphertext),
+		"context":    encodeTransitContext(context),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, _ := secret.Data["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// encodeTransitContext serializes an encryption context the way Vault's
+// Transit engine expects it: a base64-encoded JSON object.
+func encodeTransitContext(context map[string]string) string {
+	if len(context) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	for k, v := range context {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		fmt.Fprintf(&buf, "%q:%q", k, v)
+	}
+	buf.WriteByte('}')
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,60 @@
+package sneaker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestVaultStoreDataPath(t *testing.T) {
+	v := &VaultStore{Mount: "secret"}
+	if got, want := v.dataPath("prod/db"), "secret/data/prod/db"; got != want {
+		t.Errorf("dataPath = %q, want %q", got, want)
+	}
+}
+
+func TestEncodeTransitContextEmpty(t *testing.T) {
+	if got := encodeTransitContext(nil); got != "" {
+		t.Errorf("encodeTransitContext(nil) = %q, want empty", got)
+	}
+}
+
+func TestEncodeTransitContextRoundTrip(t *testing.T) {
+	context := map[string]string{"env": "prod", "service": "billing"}
+
+	encoded := encodeTransitContext(context)
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("DecodeString: %s", err)
+	}
+
+	var got map[string]string
+	if err := json.Unmarshal(decoded, &got); err != nil {
+		t.Fatalf("Unmarshal: %s", err)
+	}
+
+	if len(got) != len(context) {
+		t.Fatalf("got %v, want %v", got, context)
+	}
+	for k, want := range context {
+		if got[k] != want {
+			t.Errorf("got[%s] = %q, want %q", k, got[k], want)
+		}
+	}
+}
+
+// TestVaultStoreRequiresTransitKey confirms a VaultStore used purely as an
+// ObjectStore (no TransitKey configured) still fails clearly if something
+// does try to use it as a KeyService, rather than panicking on a nil
+// Client or silently hitting Vault's default Transit key.
+func TestVaultStoreRequiresTransitKey(t *testing.T) {
+	v := &VaultStore{Mount: "secret"}
+
+	if _, _, err := v.GenerateDataKey("", nil); err == nil {
+		t.Error("expected GenerateDataKey to fail with no TransitKey configured")
+	}
+	if _, err := v.Decrypt(nil, nil); err == nil {
+		t.Error("expected Decrypt to fail with no TransitKey configured")
+	}
+}